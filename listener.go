@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// activationListenFDStart is the first inherited file descriptor number under
+// the systemd/s6 socket-activation convention.
+const activationListenFDStart = 3
+
+func newListener(cfg Config, logger *slog.Logger) (net.Listener, error) {
+	if listeners, err := activationListeners(logger); err != nil {
+		return nil, err
+	} else if len(listeners) > 0 {
+		logger.Info("inheriting listener from supervisor", "addr", listeners[0].Addr())
+		return listeners[0], nil
+	}
+
+	var network, addr string
+
+	switch {
+	case cfg.Socket != "" && cfg.Port != "":
+		logger.Error("found both SOCKET and PORT environment variables", "socket", cfg.Socket, "port", cfg.Port)
+		panic(fmt.Sprintf("found both SOCKET=%q and PORT=%q environment variables", cfg.Socket, cfg.Port))
+	case cfg.Socket != "":
+		logger.Info("listening", "network", "unix", "addr", cfg.Socket)
+		network = "unix"
+		addr = cfg.Socket
+	case cfg.Port != "":
+		logger.Info("listening", "network", "tcp", "addr", "0.0.0.0:"+cfg.Port)
+		network = "tcp"
+		addr = ":" + cfg.Port
+	default:
+		logger.Info("unable to locate SOCKET or PORT environment variable, using default")
+		logger.Info("listening", "network", "tcp4", "addr", "127.0.0.1:5000")
+		network = "tcp4"
+		addr = "127.0.0.1:5000"
+	}
+
+	return net.Listen(network, addr)
+}
+
+// activationListeners returns the listeners passed down by a supervising init
+// system via the systemd LISTEN_FDS/LISTEN_PID protocol. It returns an empty
+// slice (and no error) when the process was not socket-activated, so callers
+// can fall back to the SOCKET/PORT env vars.
+func activationListeners(logger *slog.Logger) ([]net.Listener, error) {
+	pid, foundPID := os.LookupEnv("LISTEN_PID")
+	fds, foundFDs := os.LookupEnv("LISTEN_FDS")
+
+	if !foundPID || !foundFDs {
+		return nil, nil
+	}
+
+	if p, err := strconv.Atoi(pid); err != nil || p != os.Getpid() {
+		return nil, nil
+	}
+
+	n, err := strconv.Atoi(fds)
+	if err != nil {
+		return nil, fmt.Errorf("invalid LISTEN_FDS=%q: %w", fds, err)
+	}
+	if n < 0 {
+		return nil, fmt.Errorf("invalid LISTEN_FDS=%q: must be non-negative", fds)
+	}
+
+	logger.Debug("found socket-activation file descriptors", "count", n)
+
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	listeners := make([]net.Listener, 0, n)
+	for i := 0; i < n; i++ {
+		name := "LISTEN_FD_" + strconv.Itoa(activationListenFDStart+i)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+
+		file := os.NewFile(uintptr(activationListenFDStart+i), name)
+		listener, err := net.FileListener(file)
+		if err != nil {
+			return nil, fmt.Errorf("unable to use inherited fd %d: %w", activationListenFDStart+i, err)
+		}
+		file.Close()
+
+		listeners = append(listeners, listener)
+	}
+
+	return listeners, nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newLogger builds the process-wide slog.Logger from cfg.LogLevel
+// (debug|info|warn|error, default info) and cfg.LogFormat (text|json,
+// default text).
+func newLogger(out io.Writer, cfg Config) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: parseLogLevel(cfg.LogLevel)}
+
+	var handler slog.Handler
+	if strings.EqualFold(cfg.LogFormat, "json") {
+		handler = slog.NewJSONHandler(out, opts)
+	} else {
+		handler = slog.NewTextHandler(out, opts)
+	}
+
+	return slog.New(handler)
+}
+
+func parseLogLevel(raw string) slog.Level {
+	switch strings.ToLower(raw) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// requestLogging emits one structured line per request, replacing gin's
+// default access logger.
+func requestLogging(logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		requestID := c.GetHeader("X-Request-Id")
+		if requestID == "" {
+			requestID = fmt.Sprintf("%08x", rand.Uint32())
+			c.Request.Header.Set("X-Request-Id", requestID)
+		}
+		c.Header("X-Request-Id", requestID)
+
+		c.Next()
+
+		logger.Info("request",
+			"method", c.Request.Method,
+			"path", c.Request.URL.Path,
+			"status", c.Writer.Status(),
+			"latency", time.Since(start),
+			"remote_addr", c.ClientIP(),
+			"user_agent", c.Request.UserAgent(),
+			"request_id", requestID,
+		)
+	}
+}
+
+// recoveryLogging replaces gin's default panic recovery logging, routing
+// panics through logger instead of writing directly to stderr.
+func recoveryLogging(logger *slog.Logger) gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(io.Discard, func(c *gin.Context, recovered interface{}) {
+		logger.Error("panic recovered", "error", recovered, "path", c.Request.URL.Path)
+		c.AbortWithStatus(500)
+	})
+}
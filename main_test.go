@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func writeFixtureTemplates(t *testing.T, templatesDir string) {
+	t.Helper()
+
+	for _, sub := range []string{"layouts", "includes"} {
+		if err := os.MkdirAll(filepath.Join(templatesDir, sub), 0o755); err != nil {
+			t.Fatalf("mkdir %s: %v", sub, err)
+		}
+	}
+
+	files := map[string]string{
+		"includes/base.html": `{{define "base"}}<html><body>{{template "content" .}}</body></html>{{end}}`,
+		"layouts/index.html": `{{define "content"}}home{{end}}`,
+		"layouts/404.html":   `{{define "content"}}missing: {{.style.Headline}}{{end}}`,
+	}
+	for name, contents := range files {
+		if err := os.WriteFile(filepath.Join(templatesDir, name), []byte(contents), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+}
+
+func testConfig(t *testing.T) Config {
+	t.Helper()
+	dir := t.TempDir()
+	writeFixtureTemplates(t, dir)
+	return Config{TemplatePath: dir}
+}
+
+func TestNewRouter(t *testing.T) {
+	cfg := testConfig(t)
+	ts, err := newTemplateSet(cfg.TemplatePath)
+	if err != nil {
+		t.Fatalf("newTemplateSet: %v", err)
+	}
+
+	logger := newLogger(io.Discard, cfg)
+	router := newRouter(logger, ts, cfg)
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	cases := []struct {
+		name         string
+		path         string
+		wantStatus   int
+		wantLocation string
+	}{
+		{name: "index", path: "/", wantStatus: http.StatusOK},
+		{name: "v2 bare redirects", path: "/v2", wantStatus: http.StatusMovedPermanently, wantLocation: "/v2/"},
+		{name: "v2 not configured", path: "/v2/", wantStatus: http.StatusNotImplemented},
+		{name: "auth bare redirects", path: "/auth", wantStatus: http.StatusMovedPermanently, wantLocation: "/auth/"},
+		{name: "auth not configured", path: "/auth/", wantStatus: http.StatusNotImplemented},
+		{name: "unknown path", path: "/does-not-exist", wantStatus: http.StatusNotFound},
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := client.Get(server.URL + tc.path)
+			if err != nil {
+				t.Fatalf("GET %s: %v", tc.path, err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tc.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tc.wantStatus)
+			}
+			if got := resp.Header.Get("X-Clacks-Overhead"); got != "GNU Terry Pratchet" {
+				t.Errorf("X-Clacks-Overhead = %q, want %q", got, "GNU Terry Pratchet")
+			}
+			if tc.wantLocation != "" {
+				if got := resp.Header.Get("Location"); got != tc.wantLocation {
+					t.Errorf("Location = %q, want %q", got, tc.wantLocation)
+				}
+			}
+		})
+	}
+}
+
+// fakeEnv implements Env for tests, serving a fixed working directory and a
+// map of environment variables instead of the real process environment.
+type fakeEnv struct {
+	cwd  string
+	vars map[string]string
+}
+
+func (e fakeEnv) Getenv(key string) string { return e.vars[key] }
+func (e fakeEnv) Getwd() (string, error)   { return e.cwd, nil }
+
+// unixHTTPClient builds an http.Client that dials socketPath for every
+// request, so tests can talk to a run()-wired server without racing for an
+// ephemeral TCP port.
+func unixHTTPClient(socketPath string) *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return net.Dial("unix", socketPath)
+			},
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+}
+
+// waitForSocket blocks until socketPath is dialable or t fails the test.
+func waitForSocket(t *testing.T, socketPath string) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		conn, err := net.Dial("unix", socketPath)
+		if err == nil {
+			conn.Close()
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("server never started listening on %s", socketPath)
+}
+
+// startRun launches run() over a unix socket in t.TempDir(), so tests get a
+// predictable address without racing other tests for a TCP port. extraVars,
+// if given, are merged into the env run() sees alongside SOCKET. It returns
+// the socket path and a cancel func that shuts run() down and fails the test
+// if it doesn't exit cleanly.
+func startRun(t *testing.T, templatesDir string, signalch chan os.Signal, extraVars ...map[string]string) string {
+	t.Helper()
+
+	socketPath := filepath.Join(t.TempDir(), "test.sock")
+	vars := map[string]string{"SOCKET": socketPath}
+	for _, m := range extraVars {
+		for k, v := range m {
+			vars[k] = v
+		}
+	}
+	env := fakeEnv{
+		cwd:  filepath.Dir(templatesDir),
+		vars: vars,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() { errCh <- run(ctx, env, io.Discard, signalch) }()
+
+	t.Cleanup(func() {
+		cancel()
+		select {
+		case err := <-errCh:
+			if err != nil {
+				t.Errorf("run returned error after cancellation: %v", err)
+			}
+		case <-time.After(2 * time.Second):
+			t.Error("run did not return after ctx cancellation")
+		}
+	})
+
+	waitForSocket(t, socketPath)
+	return socketPath
+}
+
+func TestRunServesExpectedRoutes(t *testing.T) {
+	cwd := t.TempDir()
+	templatesDir := filepath.Join(cwd, "templates")
+	writeFixtureTemplates(t, templatesDir)
+
+	socketPath := startRun(t, templatesDir, make(chan os.Signal, 1))
+	client := unixHTTPClient(socketPath)
+
+	cases := []struct {
+		name         string
+		path         string
+		wantStatus   int
+		wantLocation string
+	}{
+		{name: "index", path: "/", wantStatus: http.StatusOK},
+		{name: "v2 bare redirects", path: "/v2", wantStatus: http.StatusMovedPermanently, wantLocation: "/v2/"},
+		{name: "v2 not configured", path: "/v2/", wantStatus: http.StatusNotImplemented},
+		{name: "auth bare redirects", path: "/auth", wantStatus: http.StatusMovedPermanently, wantLocation: "/auth/"},
+		{name: "auth not configured", path: "/auth/", wantStatus: http.StatusNotImplemented},
+		{name: "unknown path", path: "/does-not-exist", wantStatus: http.StatusNotFound},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := client.Get("http://unix" + tc.path)
+			if err != nil {
+				t.Fatalf("GET %s: %v", tc.path, err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tc.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tc.wantStatus)
+			}
+			if got := resp.Header.Get("X-Clacks-Overhead"); got != "GNU Terry Pratchet" {
+				t.Errorf("X-Clacks-Overhead = %q, want %q", got, "GNU Terry Pratchet")
+			}
+			if tc.wantLocation != "" {
+				if got := resp.Header.Get("Location"); got != tc.wantLocation {
+					t.Errorf("Location = %q, want %q", got, tc.wantLocation)
+				}
+			}
+		})
+	}
+}
+
+func getBody(t *testing.T, client *http.Client, url string) string {
+	t.Helper()
+
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("reading body of %s: %v", url, err)
+	}
+	return string(body)
+}
+
+func TestRunSIGHUPReloadsTemplates(t *testing.T) {
+	cwd := t.TempDir()
+	templatesDir := filepath.Join(cwd, "templates")
+	writeFixtureTemplates(t, templatesDir)
+
+	signalch := make(chan os.Signal, 1)
+	socketPath := startRun(t, templatesDir, signalch)
+	client := unixHTTPClient(socketPath)
+
+	before := getBody(t, client, "http://unix/")
+	if before != "<html><body>home</body></html>" {
+		t.Fatalf("body before reload = %q, want the original template output", before)
+	}
+
+	indexPath := filepath.Join(templatesDir, "layouts", "index.html")
+	if err := os.WriteFile(indexPath, []byte(`{{define "content"}}home-v2{{end}}`), 0o644); err != nil {
+		t.Fatalf("rewrite index.html: %v", err)
+	}
+
+	signalch <- syscall.SIGHUP
+
+	deadline := time.Now().Add(2 * time.Second)
+	var after string
+	for time.Now().Before(deadline) {
+		after = getBody(t, client, "http://unix/")
+		if after != before {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if after != "<html><body>home-v2</body></html>" {
+		t.Fatalf("body after SIGHUP reload = %q, want the rewritten template output", after)
+	}
+}
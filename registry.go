@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// errRegistryNotConfigured is returned by newRegistryHandlers when the
+// AUTH_SIGNING_KEY / AUTH_HTPASSWD_FILE env vars required to run the token
+// service are absent, so the caller can fall back to error501.
+var errRegistryNotConfigured = errors.New("AUTH_SIGNING_KEY and AUTH_HTPASSWD_FILE must both be set")
+
+// Authenticator validates registry credentials, returning the subject
+// identity to embed in the issued token on success.
+type Authenticator interface {
+	Authenticate(username, password string) (subject string, ok bool)
+}
+
+// StaticUserAuthenticator authenticates against a fixed, htpasswd-style
+// username:bcrypt-hash file, reloaded once at startup.
+type StaticUserAuthenticator struct {
+	users map[string]string
+}
+
+// NewStaticUserAuthenticator reads an htpasswd file of "user:bcrypt-hash"
+// lines (blank lines and lines starting with # are ignored).
+func NewStaticUserAuthenticator(path string) (*StaticUserAuthenticator, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	users := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		user, hash, found := strings.Cut(line, ":")
+		if !found {
+			return nil, fmt.Errorf("malformed htpasswd line %q", line)
+		}
+		users[user] = hash
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return &StaticUserAuthenticator{users: users}, nil
+}
+
+func (a *StaticUserAuthenticator) Authenticate(username, password string) (string, bool) {
+	hash, ok := a.users[username]
+	if !ok {
+		return "", false
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		return "", false
+	}
+	return username, true
+}
+
+// registryError is a single entry of a v2 error response body, per the OCI
+// distribution spec.
+type registryError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func writeRegistryError(c *gin.Context, status int, code, message string) {
+	c.JSON(status, gin.H{"errors": []registryError{{Code: code, Message: message}}})
+}
+
+// v2Root handles GET /v2/, the registry's discovery endpoint. Since this
+// root never serves anonymous pulls, it always challenges the client for a
+// bearer token.
+func v2Root(c *gin.Context) {
+	service := c.Request.Host
+	c.Header("Www-Authenticate", fmt.Sprintf(`Bearer realm="https://%s/auth/",service=%q`, service, service))
+	writeRegistryError(c, http.StatusUnauthorized, "UNAUTHORIZED", "authentication required")
+}
+
+// accessEntry is one element of a token's "access" claim, describing the
+// actions granted on a single scoped resource.
+type accessEntry struct {
+	Type    string   `json:"type"`
+	Name    string   `json:"name"`
+	Actions []string `json:"actions"`
+}
+
+// parseScope parses the space-separated "type:name:actions,..." scope query
+// parameter described by the distribution token-auth spec.
+func parseScope(scope string) []accessEntry {
+	if scope == "" {
+		return nil
+	}
+
+	var entries []accessEntry
+	for _, part := range strings.Fields(scope) {
+		fields := strings.SplitN(part, ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		entries = append(entries, accessEntry{
+			Type:    fields[0],
+			Name:    fields[1],
+			Actions: strings.Split(fields[2], ","),
+		})
+	}
+	return entries
+}
+
+type tokenClaims struct {
+	Access []accessEntry `json:"access,omitempty"`
+	jwt.RegisteredClaims
+}
+
+const tokenTTL = 5 * time.Minute
+
+// newAuthHandler returns the /auth/ token-issuance handler: it validates the
+// request's Basic-auth credentials against authenticator and, on success,
+// signs a JWT carrying the requested access scope.
+func newAuthHandler(authenticator Authenticator, issuer string, signingKey interface{}, signingMethod jwt.SigningMethod, logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		username, password, ok := c.Request.BasicAuth()
+		if !ok {
+			c.Header("Www-Authenticate", `Basic realm="registry"`)
+			writeRegistryError(c, http.StatusUnauthorized, "UNAUTHORIZED", "basic auth credentials required")
+			return
+		}
+
+		subject, ok := authenticator.Authenticate(username, password)
+		if !ok {
+			writeRegistryError(c, http.StatusUnauthorized, "UNAUTHORIZED", "invalid username or password")
+			return
+		}
+
+		service := c.Query("service")
+		now := time.Now()
+		claims := tokenClaims{
+			Access: parseScope(c.Query("scope")),
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    issuer,
+				Subject:   subject,
+				Audience:  jwt.ClaimStrings{service},
+				ExpiresAt: jwt.NewNumericDate(now.Add(tokenTTL)),
+				IssuedAt:  jwt.NewNumericDate(now),
+			},
+		}
+
+		signed, err := jwt.NewWithClaims(signingMethod, claims).SignedString(signingKey)
+		if err != nil {
+			logger.Error("unable to sign registry token", "error", err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"token":        signed,
+			"access_token": signed,
+			"expires_in":   int(tokenTTL.Seconds()),
+			"issued_at":    now.UTC().Format(time.RFC3339),
+		})
+	}
+}
+
+// newRegistryHandlers builds the /v2/ and /auth/ handlers from cfg. It
+// returns errRegistryNotConfigured when AuthSigningKey or AuthHtpasswd is
+// unset so the caller can fall back to the placeholder 501 handlers.
+func newRegistryHandlers(cfg Config, logger *slog.Logger) (v2, auth gin.HandlerFunc, err error) {
+	if cfg.AuthSigningKey == "" || cfg.AuthHtpasswd == "" {
+		return nil, nil, errRegistryNotConfigured
+	}
+
+	keyPEM, err := os.ReadFile(cfg.AuthSigningKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to read AUTH_SIGNING_KEY: %w", err)
+	}
+
+	signingKey, err := jwt.ParseRSAPrivateKeyFromPEM(keyPEM)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to parse AUTH_SIGNING_KEY: %w", err)
+	}
+
+	authenticator, err := NewStaticUserAuthenticator(cfg.AuthHtpasswd)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to load AUTH_HTPASSWD_FILE: %w", err)
+	}
+
+	issuer := cfg.AuthIssuer
+	if issuer == "" {
+		issuer = "docker-registry-root"
+	}
+
+	return v2Root, newAuthHandler(authenticator, issuer, signingKey, jwt.SigningMethodRS256, logger), nil
+}
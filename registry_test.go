@@ -0,0 +1,248 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func writeHtpasswd(t *testing.T, dir, username, password string) string {
+	t.Helper()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("bcrypt.GenerateFromPassword: %v", err)
+	}
+
+	path := filepath.Join(dir, "htpasswd")
+	contents := username + ":" + string(hash) + "\n"
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatalf("write htpasswd: %v", err)
+	}
+	return path
+}
+
+func TestStaticUserAuthenticatorAuthenticate(t *testing.T) {
+	dir := t.TempDir()
+	path := writeHtpasswd(t, dir, "alice", "hunter2")
+
+	authenticator, err := NewStaticUserAuthenticator(path)
+	if err != nil {
+		t.Fatalf("NewStaticUserAuthenticator: %v", err)
+	}
+
+	cases := []struct {
+		name        string
+		username    string
+		password    string
+		wantSubject string
+		wantOK      bool
+	}{
+		{name: "unknown user", username: "bob", password: "hunter2", wantOK: false},
+		{name: "wrong password", username: "alice", password: "wrong", wantOK: false},
+		{name: "success", username: "alice", password: "hunter2", wantSubject: "alice", wantOK: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			subject, ok := authenticator.Authenticate(tc.username, tc.password)
+			if ok != tc.wantOK {
+				t.Fatalf("ok = %v, want %v", ok, tc.wantOK)
+			}
+			if subject != tc.wantSubject {
+				t.Errorf("subject = %q, want %q", subject, tc.wantSubject)
+			}
+		})
+	}
+}
+
+func TestParseScope(t *testing.T) {
+	cases := []struct {
+		name  string
+		scope string
+		want  []accessEntry
+	}{
+		{name: "empty", scope: "", want: nil},
+		{
+			name:  "single action",
+			scope: "repository:library/nginx:pull",
+			want: []accessEntry{
+				{Type: "repository", Name: "library/nginx", Actions: []string{"pull"}},
+			},
+		},
+		{
+			name:  "multiple actions",
+			scope: "repository:library/nginx:pull,push",
+			want: []accessEntry{
+				{Type: "repository", Name: "library/nginx", Actions: []string{"pull", "push"}},
+			},
+		},
+		{
+			name:  "multiple scopes",
+			scope: "repository:library/nginx:pull registry:catalog:*",
+			want: []accessEntry{
+				{Type: "repository", Name: "library/nginx", Actions: []string{"pull"}},
+				{Type: "registry", Name: "catalog", Actions: []string{"*"}},
+			},
+		},
+		{name: "malformed scope is skipped", scope: "not-a-valid-scope", want: nil},
+		{
+			name:  "malformed scope alongside a valid one",
+			scope: "not-a-valid-scope repository:library/nginx:pull",
+			want: []accessEntry{
+				{Type: "repository", Name: "library/nginx", Actions: []string{"pull"}},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := parseScope(tc.scope)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("parseScope(%q) = %#v, want %#v", tc.scope, got, tc.want)
+			}
+		})
+	}
+}
+
+// writeRSAKeyPEM generates an RSA private key and writes it PEM-encoded to
+// dir, returning the path. The registry only ever reads the private half.
+func writeRSAKeyPEM(t *testing.T, dir string) string {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("rsa.GenerateKey: %v", err)
+	}
+
+	block := &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}
+	path := filepath.Join(dir, "signing.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatalf("write signing key: %v", err)
+	}
+	return path
+}
+
+func TestRunAuthIssuesSignedToken(t *testing.T) {
+	cwd := t.TempDir()
+	templatesDir := filepath.Join(cwd, "templates")
+	writeFixtureTemplates(t, templatesDir)
+
+	keyDir := t.TempDir()
+	signingKeyPath := writeRSAKeyPEM(t, keyDir)
+	htpasswdPath := writeHtpasswd(t, keyDir, "alice", "hunter2")
+
+	extraVars := map[string]string{
+		"AUTH_SIGNING_KEY":   signingKeyPath,
+		"AUTH_HTPASSWD_FILE": htpasswdPath,
+		"AUTH_ISSUER":        "test-issuer",
+	}
+
+	socketPath := startRun(t, templatesDir, make(chan os.Signal, 1), extraVars)
+	client := unixHTTPClient(socketPath)
+
+	req, err := http.NewRequest(http.MethodGet, "http://unix/auth/?service=registry.example&scope=repository:library/nginx:pull", nil)
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	req.SetBasicAuth("alice", "hunter2")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("GET /auth/: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+
+	var body struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if body.Token == "" {
+		t.Fatal("response token is empty")
+	}
+
+	keyPEM, err := os.ReadFile(signingKeyPath)
+	if err != nil {
+		t.Fatalf("read signing key: %v", err)
+	}
+	signingKey, err := jwt.ParseRSAPrivateKeyFromPEM(keyPEM)
+	if err != nil {
+		t.Fatalf("parse signing key: %v", err)
+	}
+
+	var claims tokenClaims
+	token, err := jwt.ParseWithClaims(body.Token, &claims, func(*jwt.Token) (interface{}, error) {
+		return &signingKey.PublicKey, nil
+	})
+	if err != nil {
+		t.Fatalf("parse issued token: %v", err)
+	}
+	if !token.Valid {
+		t.Fatal("issued token is not valid")
+	}
+
+	if claims.Issuer != "test-issuer" {
+		t.Errorf("iss = %q, want %q", claims.Issuer, "test-issuer")
+	}
+	if claims.Subject != "alice" {
+		t.Errorf("sub = %q, want %q", claims.Subject, "alice")
+	}
+	want := jwt.ClaimStrings{"registry.example"}
+	if !reflect.DeepEqual(claims.Audience, want) {
+		t.Errorf("aud = %v, want %v", claims.Audience, want)
+	}
+
+	wantAccess := []accessEntry{
+		{Type: "repository", Name: "library/nginx", Actions: []string{"pull"}},
+	}
+	if !reflect.DeepEqual(claims.Access, wantAccess) {
+		t.Errorf("access = %#v, want %#v", claims.Access, wantAccess)
+	}
+}
+
+func TestRunAuthRejectsWrongPassword(t *testing.T) {
+	cwd := t.TempDir()
+	templatesDir := filepath.Join(cwd, "templates")
+	writeFixtureTemplates(t, templatesDir)
+
+	keyDir := t.TempDir()
+	extraVars := map[string]string{
+		"AUTH_SIGNING_KEY":   writeRSAKeyPEM(t, keyDir),
+		"AUTH_HTPASSWD_FILE": writeHtpasswd(t, keyDir, "alice", "hunter2"),
+	}
+
+	socketPath := startRun(t, templatesDir, make(chan os.Signal, 1), extraVars)
+	client := unixHTTPClient(socketPath)
+
+	req, err := http.NewRequest(http.MethodGet, "http://unix/auth/", nil)
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	req.SetBasicAuth("alice", "wrong")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("GET /auth/: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type style struct {
+	Stylesheets []string
+	Headline    string
+	Blurb       string
+}
+
+type styleset []style
+
+func init() {
+	rand.Seed(time.Now().Unix())
+}
+
+var styles = styleset{
+	style{
+		[]string{
+			"https://fonts.googleapis.com/css?family=Montserrat:200,400,700",
+			"static/css/404-04.css",
+		},
+		"Oops!",
+		"The page cannot be found",
+	},
+}
+
+func (ss styleset) randomStyle() style {
+	n := len(ss)
+	if n == 0 {
+		return style{}
+	}
+
+	idx := rand.Intn(n)
+	return ss[idx]
+}
+
+// newRouter builds the gin engine: middleware, static assets, the registry
+// v2/auth endpoints, and the catch-all 404 page.
+func newRouter(logger *slog.Logger, ts *templateset, cfg Config) *gin.Engine {
+	router := gin.New()
+	router.HandleMethodNotAllowed = true
+	router.HTMLRender = ts
+	router.Use(recoveryLogging(logger), requestLogging(logger), clacksOverhead)
+
+	router.Static("/static", "./static")
+
+	router.GET("/", func(c *gin.Context) {
+		c.HTML(http.StatusOK, "index.html", nil)
+	})
+
+	v2Handler, authHandler, err := newRegistryHandlers(cfg, logger)
+	if err != nil {
+		logger.Info("registry auth not configured, returning 501 for /v2/ and /auth/", "error", err)
+		v2Handler, authHandler = error501, error501
+	}
+
+	router.Any("/auth", appendSlash)
+	router.Any("/auth/", authHandler)
+	router.Any("/v2", appendSlash)
+	router.Any("/v2/", v2Handler)
+
+	router.NoRoute(func(c *gin.Context) {
+		c.HTML(http.StatusNotFound, "404.html", gin.H{
+			"style": styles.randomStyle(),
+		})
+	})
+
+	return router
+}
+
+func clacksOverhead(c *gin.Context) {
+	c.Header("X-Clacks-Overhead", "GNU Terry Pratchet")
+	c.Next()
+}
+
+func error501(c *gin.Context) {
+	c.AbortWithError(501, errors.New("not implemented"))
+}
+
+func appendSlash(c *gin.Context) {
+	path := c.Request.URL.Path + "/"
+	c.Redirect(301, path)
+}
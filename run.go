@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"syscall"
+	"time"
+)
+
+// Env abstracts environment variable lookups so run can be exercised in
+// tests without touching the process environment.
+type Env interface {
+	Getenv(key string) string
+	Getwd() (string, error)
+}
+
+// osEnv implements Env against the real process environment.
+type osEnv struct{}
+
+func (osEnv) Getenv(key string) string { return os.Getenv(key) }
+func (osEnv) Getwd() (string, error)   { return os.Getwd() }
+
+// Config holds everything run needs to wire up the server, gathered from Env
+// up front so the rest of the program never reads the environment directly.
+type Config struct {
+	TemplatePath   string
+	Socket         string
+	Port           string
+	TemplateWatch  bool
+	LogLevel       string
+	LogFormat      string
+	AuthSigningKey string
+	AuthHtpasswd   string
+	AuthIssuer     string
+	TLSCert        string
+	TLSKey         string
+	ACMEDomains    string
+	ACMECacheDir   string
+}
+
+// configFromEnv populates a Config from env, resolving TemplatePath relative
+// to the current working directory the same way main always has.
+func configFromEnv(env Env) (Config, error) {
+	cwd, err := env.Getwd()
+	if err != nil {
+		return Config{}, fmt.Errorf("unable to locate the current working directory: %w", err)
+	}
+
+	cfg := Config{
+		TemplatePath:   path.Join(cwd, "templates"),
+		Socket:         env.Getenv("SOCKET"),
+		Port:           env.Getenv("PORT"),
+		TemplateWatch:  env.Getenv("TEMPLATE_WATCH") == "1",
+		LogLevel:       env.Getenv("LOG_LEVEL"),
+		LogFormat:      env.Getenv("LOG_FORMAT"),
+		AuthSigningKey: env.Getenv("AUTH_SIGNING_KEY"),
+		AuthHtpasswd:   env.Getenv("AUTH_HTPASSWD_FILE"),
+		AuthIssuer:     env.Getenv("AUTH_ISSUER"),
+		TLSCert:        env.Getenv("TLS_CERT"),
+		TLSKey:         env.Getenv("TLS_KEY"),
+		ACMEDomains:    env.Getenv("ACME_DOMAINS"),
+		ACMECacheDir:   env.Getenv("ACME_CACHE_DIR"),
+	}
+
+	if (cfg.TLSCert == "") != (cfg.TLSKey == "") {
+		return Config{}, fmt.Errorf("TLS_CERT and TLS_KEY must both be set or both be empty")
+	}
+
+	return cfg, nil
+}
+
+// run builds the server from env and blocks until signalch delivers a
+// non-SIGHUP signal or ctx is cancelled, then shuts down gracefully. It never
+// calls log.Fatal/os.Exit itself; the caller decides what a returned error
+// means for the process exit code.
+func run(ctx context.Context, env Env, out io.Writer, signalch <-chan os.Signal) error {
+	cfg, err := configFromEnv(env)
+	if err != nil {
+		return err
+	}
+
+	logger := newLogger(out, cfg)
+
+	logger.Info("searching for templates", "path", cfg.TemplatePath)
+	ts, err := newTemplateSet(cfg.TemplatePath)
+	if err != nil {
+		return fmt.Errorf("unable to compile templates: %w", err)
+	}
+	logger.Info("found templates", "count", len(ts.store))
+	for name := range ts.store {
+		logger.Debug("found template", "name", name)
+	}
+
+	listener, err := newListener(cfg, logger)
+	if err != nil {
+		return fmt.Errorf("unable to open listener: %w", err)
+	}
+
+	if cfg.TemplateWatch {
+		watcher, err := watchTemplates(cfg.TemplatePath, ts, logger)
+		if err != nil {
+			return fmt.Errorf("unable to start template watcher: %w", err)
+		}
+		defer watcher.Close()
+	}
+
+	router := newRouter(logger, ts, cfg)
+
+	return serve(ctx, logger, router, listener, ts, cfg, signalch)
+}
+
+func serve(ctx context.Context, logger *slog.Logger, handler http.Handler, listener net.Listener, ts *templateset, cfg Config, signalch <-chan os.Signal) error {
+	defer logger.Info("terminating")
+
+	tlsConfig, acmeHandler, err := buildServerTLS(cfg)
+	if err != nil {
+		return err
+	}
+
+	server := &http.Server{Handler: handler, TLSConfig: tlsConfig}
+
+	var challengeServer *http.Server
+	var challengeListener net.Listener
+	if acmeHandler != nil {
+		challengeListener, err = net.Listen("tcp", ":80")
+		if err != nil {
+			return fmt.Errorf("unable to open ACME HTTP-01 challenge listener: %w", err)
+		}
+
+		challengeServer = &http.Server{Handler: acmeHandler}
+		go func() {
+			if err := challengeServer.Serve(challengeListener); err != nil && err != http.ErrServerClosed {
+				logger.Error("acme challenge server error", "error", err)
+			}
+		}()
+	}
+
+	serverErr := make(chan error, 1)
+	go func() {
+		var err error
+		if tlsConfig != nil {
+			err = server.ServeTLS(listener, "", "")
+		} else {
+			err = server.Serve(listener)
+		}
+		if err == http.ErrServerClosed {
+			err = nil
+		}
+		serverErr <- err
+	}()
+
+	var serveErr error
+	serverStopped := false
+
+loop:
+	for {
+		select {
+		case err := <-serverErr:
+			serveErr = err
+			serverStopped = true
+			break loop
+		case <-ctx.Done():
+			break loop
+		case sig, ok := <-signalch:
+			if !ok {
+				break loop
+			}
+			logger.Info("got signal", "signal", sig)
+			if sig == syscall.SIGHUP {
+				reloadTemplateSet(logger, ts, cfg.TemplatePath)
+				continue
+			}
+			break loop
+		}
+	}
+
+	// However we left the loop above, both listeners share this one 5s
+	// shutdown deadline — including when the main server failed on its own,
+	// so the ACME challenge listener never leaks.
+	logger.Info("shutting down...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil && serveErr == nil {
+		serveErr = fmt.Errorf("error during shutdown: %w", err)
+	}
+	if challengeServer != nil {
+		if err := challengeServer.Shutdown(shutdownCtx); err != nil && serveErr == nil {
+			serveErr = fmt.Errorf("error during ACME challenge server shutdown: %w", err)
+		}
+	}
+
+	if !serverStopped {
+		if err := <-serverErr; err != nil && serveErr == nil {
+			serveErr = err
+		}
+	}
+
+	return serveErr
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"log/slog"
+	"path/filepath"
+	"sync"
+
+	"github.com/gin-gonic/gin/render"
+)
+
+type templateset struct {
+	mu    sync.RWMutex
+	store map[string]*template.Template
+}
+
+func newTemplateSet(templatesDir string) (*templateset, error) {
+	templates := make(map[string]*template.Template)
+
+	layouts, err := filepath.Glob(templatesDir + "/layouts/*.html")
+	if err != nil {
+		return nil, err
+	}
+
+	includes, err := filepath.Glob(templatesDir + "/includes/*.html")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, layout := range layouts {
+		files := append(includes, layout)
+		name := filepath.Base(layout)
+		templates[name] = template.Must(template.ParseFiles(files...))
+	}
+
+	return &templateset{store: templates}, nil
+}
+
+// reload rebuilds the template set from templatesDir and atomically swaps it
+// in, so a request that lands mid-reload still sees a consistent store.
+func (ts *templateset) reload(templatesDir string) error {
+	fresh, err := newTemplateSet(templatesDir)
+	if err != nil {
+		return err
+	}
+
+	ts.mu.Lock()
+	ts.store = fresh.store
+	ts.mu.Unlock()
+
+	return nil
+}
+
+// reloadTemplateSet rebuilds ts from templatePath, logging the outcome. It is
+// shared by the SIGHUP handler in serve and the fsnotify watcher so both
+// reload paths behave identically.
+func reloadTemplateSet(logger *slog.Logger, ts *templateset, templatePath string) {
+	logger.Info("reloading templates")
+	if err := ts.reload(templatePath); err != nil {
+		logger.Error("failed to rebuild templates", "error", err)
+		return
+	}
+	logger.Info("templates reloaded")
+}
+
+func (ts *templateset) Locate(name string) (*template.Template, error) {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	if tmpl, ok := ts.store[name]; ok {
+		return tmpl, nil
+	}
+
+	return nil, fmt.Errorf("template %s does not exist", name)
+}
+
+func (ts *templateset) Instance(name string, data interface{}) render.Render {
+	return &render.HTML{
+		Template: template.Must(ts.Locate(name)),
+		Name:     "base",
+		Data:     data,
+	}
+}
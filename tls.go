@@ -0,0 +1,57 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// buildServerTLS derives the main listener's TLS configuration from cfg. It
+// returns a nil *tls.Config (and a nil handler) when neither TLS_CERT/TLS_KEY
+// nor ACME_DOMAINS is set, so the caller falls back to plain HTTP.
+//
+// When ACME_DOMAINS is set, the returned handler must be served on :80
+// alongside the main TLS listener so autocert can complete the HTTP-01
+// challenge; every other request it receives is redirected to https.
+func buildServerTLS(cfg Config) (*tls.Config, http.Handler, error) {
+	switch {
+	case cfg.ACMEDomains != "" && cfg.TLSCert != "":
+		return nil, nil, fmt.Errorf("found both ACME_DOMAINS and TLS_CERT/TLS_KEY environment variables")
+	case (cfg.TLSCert == "") != (cfg.TLSKey == ""):
+		return nil, nil, fmt.Errorf("TLS_CERT and TLS_KEY must both be set or both be empty")
+	case cfg.ACMEDomains != "":
+		domains := strings.Split(cfg.ACMEDomains, ",")
+		for i := range domains {
+			domains[i] = strings.TrimSpace(domains[i])
+		}
+
+		cacheDir := cfg.ACMECacheDir
+		if cacheDir == "" {
+			cacheDir = "./acme-cache"
+		}
+
+		certManager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(domains...),
+			Cache:      autocert.DirCache(cacheDir),
+		}
+
+		return certManager.TLSConfig(), certManager.HTTPHandler(http.HandlerFunc(redirectToHTTPS)), nil
+	case cfg.TLSCert != "" && cfg.TLSKey != "":
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCert, cfg.TLSKey)
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to load TLS_CERT/TLS_KEY: %w", err)
+		}
+		return &tls.Config{Certificates: []tls.Certificate{cert}}, nil, nil
+	default:
+		return nil, nil, nil
+	}
+}
+
+func redirectToHTTPS(w http.ResponseWriter, r *http.Request) {
+	target := "https://" + r.Host + r.URL.RequestURI()
+	http.Redirect(w, r, target, http.StatusMovedPermanently)
+}
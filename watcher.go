@@ -0,0 +1,64 @@
+package main
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// templateWatchDebounce coalesces bursts of fs events (editors often emit
+// several in quick succession for a single save) into a single reload.
+const templateWatchDebounce = 250 * time.Millisecond
+
+// watchTemplates watches templatesDir/layouts and templatesDir/includes for
+// create/write/rename/remove events and reloads ts in response, debounced by
+// templateWatchDebounce. The caller is responsible for closing the returned
+// watcher on shutdown.
+func watchTemplates(templatesDir string, ts *templateset, logger *slog.Logger) (*fsnotify.Watcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, dir := range []string{templatesDir + "/layouts", templatesDir + "/includes"} {
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+			return nil, err
+		}
+	}
+
+	go debounceReload(watcher, ts, templatesDir, logger)
+
+	logger.Info("watching templates for changes", "path", templatesDir)
+	return watcher, nil
+}
+
+func debounceReload(watcher *fsnotify.Watcher, ts *templateset, templatesDir string, logger *slog.Logger) {
+	var timer *time.Timer
+
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if !event.Has(fsnotify.Create | fsnotify.Write | fsnotify.Rename | fsnotify.Remove) {
+				continue
+			}
+
+			if timer == nil {
+				timer = time.AfterFunc(templateWatchDebounce, func() {
+					reloadTemplateSet(logger, ts, templatesDir)
+				})
+			} else {
+				timer.Reset(templateWatchDebounce)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			logger.Error("template watcher error", "error", err)
+		}
+	}
+}